@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Chunk is a single chunk of a document ready to be embedded or stored.
+type Chunk struct {
+	Number  int
+	Content string
+}
+
+// DocumentRef identifies a document being indexed, for backends to
+// record alongside its chunks so search results can cite it.
+type DocumentRef struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+// Hit is a single search result returned by an IndexBackend. Score ranks
+// hits within a single query but its scale and meaning are
+// backend-specific: cosine distance in [0,2] (smaller is closer) for the
+// file backend, raw Euclidean "embedding <-> $1" distance (smaller is
+// closer) for postgres, and the opensearch k-NN plugin's own _score
+// (larger is closer) for opensearch. Callers must not compare Score
+// across backends or treat it as a cosine similarity/distance.
+type Hit struct {
+	DocID       string
+	DocTitle    string
+	DocLink     string
+	ChunkNumber int
+	Content     string
+	Score       float64
+}
+
+// IndexHeader records which embedding provider and model an index was
+// built with, so a query run with a different provider can fail fast
+// instead of comparing incompatible vectors.
+type IndexHeader struct {
+	EmbedderProvider string `json:"embedder_provider"`
+	EmbedderModel    string `json:"embedder_model"`
+	Dimensions       int    `json:"dimensions"`
+}
+
+// Empty reports whether the header hasn't been set yet.
+func (h IndexHeader) Empty() bool {
+	return h == IndexHeader{}
+}
+
+// Compatible reports whether an index built with h can be queried
+// using the embedder described by h2.
+func (h IndexHeader) Compatible(h2 IndexHeader) bool {
+	return h.EmbedderProvider == h2.EmbedderProvider &&
+		h.EmbedderModel == h2.EmbedderModel &&
+		h.Dimensions == h2.Dimensions
+}
+
+// IndexBackend stores document chunk embeddings and serves nearest
+// neighbor queries against them. Implementations may keep everything
+// in memory and persist to a single file, or delegate storage and
+// search to an external vector store.
+type IndexBackend interface {
+	// Upsert adds or replaces the chunks and vectors for doc.
+	Upsert(ctx context.Context, doc DocumentRef, chunks []Chunk, vectors []Vector) error
+	// Query returns the topK chunks closest to vec.
+	Query(ctx context.Context, vec Vector, topK int) ([]Hit, error)
+	// Load reads the backend's state from path, if applicable.
+	Load(path string) error
+	// Save writes the backend's state to path, if applicable.
+	Save(path string) error
+	// Header returns the embedder metadata the index was built with.
+	Header() IndexHeader
+	// SetHeader records the embedder metadata the index is being
+	// built with.
+	SetHeader(IndexHeader)
+	// SyncState returns the value previously stored under key by
+	// SetSyncState, used by incremental ingestion sources to remember
+	// how far they've synced. ok is false if key has never been set.
+	SyncState(key string) (value string, ok bool)
+	// SetSyncState records value under key.
+	SetSyncState(key, value string)
+}
+
+var backendFlag = flag.String("backend", envOr("AMA_BACKEND", "file"), "Index backend to use: file, postgres or opensearch")
+
+// newBackend constructs the IndexBackend named by name.
+func newBackend(name string) (IndexBackend, error) {
+	switch name {
+	case "", "file":
+		return newFileBackend(*efFlag), nil
+	case "postgres":
+		return newPostgresBackend()
+	case "opensearch":
+		return newOpenSearchBackend()
+	default:
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+}
+
+// envOr returns the value of the environment variable named key, or def
+// if it's not set.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
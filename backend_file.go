@@ -0,0 +1,175 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// fileChunk is a single stored chunk in a fileBackend index.
+type fileChunk struct {
+	DocID       string `json:"doc"`
+	ChunkNumber int    `json:"chunk"`
+	Content     string `json:"content"`
+	Vector      Vector `json:"vec"`
+}
+
+// fileBackend is the default IndexBackend: it keeps everything in
+// memory and persists to a single gzipped JSON file, alongside an HNSW
+// graph built at index time for approximate nearest neighbor search.
+type fileBackend struct {
+	Hdr    IndexHeader            `json:"header"`
+	Docs   map[string]DocumentRef `json:"docs"`
+	Chunks []fileChunk            `json:"chunks"`
+	Sync   map[string]string      `json:"sync_state"`
+	Graph  *HNSW                  `json:"graph,omitempty"`
+
+	// efSearch is the query-time ef parameter; it's a runtime knob, not
+	// part of the persisted index.
+	efSearch int
+}
+
+// newFileBackend returns an empty fileBackend that searches with the
+// given efSearch.
+func newFileBackend(efSearch int) *fileBackend {
+	return &fileBackend{efSearch: efSearch}
+}
+
+// Upsert implements IndexBackend.
+func (b *fileBackend) Upsert(ctx context.Context, doc DocumentRef, chunks []Chunk, vectors []Vector) error {
+	kept := b.Chunks[:0]
+	for _, c := range b.Chunks {
+		if c.DocID != doc.ID {
+			kept = append(kept, c)
+		}
+	}
+	b.Chunks = kept
+	for i, c := range chunks {
+		b.Chunks = append(b.Chunks, fileChunk{
+			DocID:       doc.ID,
+			ChunkNumber: c.Number,
+			Content:     c.Content,
+			Vector:      vectors[i],
+		})
+	}
+	if b.Docs == nil {
+		b.Docs = make(map[string]DocumentRef)
+	}
+	b.Docs[doc.ID] = doc
+	// The graph is rebuilt wholesale in Save, since node ids are
+	// positions in Chunks and upserts can reorder it.
+	b.Graph = nil
+	return nil
+}
+
+// Query implements IndexBackend.
+func (b *fileBackend) Query(ctx context.Context, vec Vector, topK int) ([]Hit, error) {
+	if b.Graph != nil && len(b.Graph.Nodes) == len(b.Chunks) {
+		return b.queryGraph(vec, topK), nil
+	}
+	return b.queryLinear(vec, topK), nil
+}
+
+// queryGraph answers a query using the persisted HNSW graph.
+func (b *fileBackend) queryGraph(vec Vector, topK int) []Hit {
+	candidates := b.Graph.Search(vec, b.efSearch, topK)
+	hits := make([]Hit, len(candidates))
+	for i, c := range candidates {
+		ch := b.Chunks[c.ID]
+		doc := b.Docs[ch.DocID]
+		hits[i] = Hit{
+			DocID: ch.DocID, DocTitle: doc.Title, DocLink: doc.Link,
+			ChunkNumber: ch.ChunkNumber, Content: ch.Content, Score: c.Dist,
+		}
+	}
+	return hits
+}
+
+// queryLinear answers a query with a full scan, used as a fallback
+// when no graph has been built yet (e.g. an index saved before this
+// field existed).
+func (b *fileBackend) queryLinear(vec Vector, topK int) []Hit {
+	sort.Slice(b.Chunks, func(i, j int) bool {
+		return b.Chunks[i].Vector.Distance(vec) < b.Chunks[j].Vector.Distance(vec)
+	})
+	if topK > len(b.Chunks) {
+		topK = len(b.Chunks)
+	}
+	hits := make([]Hit, topK)
+	for i := 0; i < topK; i++ {
+		c := b.Chunks[i]
+		doc := b.Docs[c.DocID]
+		hits[i] = Hit{
+			DocID:       c.DocID,
+			DocTitle:    doc.Title,
+			DocLink:     doc.Link,
+			ChunkNumber: c.ChunkNumber,
+			Content:     c.Content,
+			Score:       c.Vector.Distance(vec),
+		}
+	}
+	return hits
+}
+
+// Load implements IndexBackend.
+func (b *fileBackend) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(gz).Decode(b)
+}
+
+// Header implements IndexBackend.
+func (b *fileBackend) Header() IndexHeader { return b.Hdr }
+
+// SetHeader implements IndexBackend.
+func (b *fileBackend) SetHeader(h IndexHeader) { b.Hdr = h }
+
+// SyncState implements IndexBackend.
+func (b *fileBackend) SyncState(key string) (string, bool) {
+	v, ok := b.Sync[key]
+	return v, ok
+}
+
+// SetSyncState implements IndexBackend.
+func (b *fileBackend) SetSyncState(key, value string) {
+	if b.Sync == nil {
+		b.Sync = make(map[string]string)
+	}
+	b.Sync[key] = value
+}
+
+// buildGraph constructs an HNSW graph over the current chunks from
+// scratch, so node ids line up with positions in b.Chunks.
+func (b *fileBackend) buildGraph() {
+	g := newHNSW(hnswDefaultM, hnswDefaultEfConstruction)
+	for _, c := range b.Chunks {
+		g.Insert(c.Vector)
+	}
+	b.Graph = g
+}
+
+// Save implements IndexBackend.
+func (b *fileBackend) Save(path string) error {
+	b.buildGraph()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	if err := json.NewEncoder(gz).Encode(b); err != nil {
+		return err
+	}
+	return gz.Flush()
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	opensearch "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+	requestsigner "github.com/opensearch-project/opensearch-go/v2/signer/awsv2"
+)
+
+// opensearchBackend stores chunk embeddings in an OpenSearch (or
+// OpenSearch Serverless) k-NN index, authenticating with AWS SigV4.
+type opensearchBackend struct {
+	cl    *opensearch.Client
+	index string
+	hdr   IndexHeader
+}
+
+// metaDocPrefix marks documents used to persist index metadata
+// (header, sync state) alongside the chunks in the same index, so
+// queries can exclude them.
+const metaDocPrefix = "__ama_meta__"
+
+// headerDocID is the id of the document used to persist the
+// IndexHeader.
+const headerDocID = metaDocPrefix + ":header"
+
+// syncStateDocID is the id of the document used to persist sync
+// cursors for incremental ingestion sources, keyed by source key.
+func syncStateDocID(key string) string { return metaDocPrefix + ":sync:" + key }
+
+// newOpenSearchBackend builds a client for the endpoint named by the
+// AMA_OPENSEARCH_URL env var, signing requests for the "aoss" service
+// when AMA_OPENSEARCH_SERVERLESS is set, or "es" otherwise.
+func newOpenSearchBackend() (*opensearchBackend, error) {
+	endpoint := os.Getenv("AMA_OPENSEARCH_URL")
+	if endpoint == "" {
+		return nil, fmt.Errorf("AMA_OPENSEARCH_URL is not set")
+	}
+	service := "es"
+	if os.Getenv("AMA_OPENSEARCH_SERVERLESS") != "" {
+		service = "aoss"
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	signer, err := requestsigner.NewSignerWithService(awsCfg, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS SigV4 signer: %w", err)
+	}
+
+	cl, err := opensearch.NewClient(opensearch.Config{
+		Addresses: []string{endpoint},
+		Signer:    signer,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opensearch client: %w", err)
+	}
+
+	index := envOr("AMA_OPENSEARCH_INDEX", "ama-chunks")
+	b := &opensearchBackend{cl: cl, index: index}
+
+	res, err := b.cl.Get(b.index, headerDocID, b.cl.Get.WithContext(context.Background()))
+	if err == nil {
+		defer res.Body.Close()
+		if !res.IsError() {
+			var got struct {
+				Source struct {
+					Header IndexHeader `json:"header"`
+				} `json:"_source"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&got); err == nil {
+				b.hdr = got.Source.Header
+			}
+		}
+	}
+	return b, nil
+}
+
+type opensearchDoc struct {
+	DocID       string `json:"doc_id"`
+	DocTitle    string `json:"doc_title"`
+	DocLink     string `json:"doc_link"`
+	ChunkNumber int    `json:"chunk_number"`
+	Content     string `json:"content"`
+	Embedding   Vector `json:"embedding"`
+}
+
+// ensureIndex creates the backing index with a knn_vector mapping for
+// "embedding" before the first document (the header or a chunk) is
+// written to it. This can't happen in
+// newOpenSearchBackend because OpenSearch requires the vector dimension
+// up front and that isn't known until the first embedding arrives; left
+// to dynamic mapping, "embedding" would come in as a plain numeric
+// array and the knn query in Query would fail against it.
+func (b *opensearchBackend) ensureIndex(ctx context.Context, dims int) error {
+	exists, err := b.cl.Indices.Exists([]string{b.index}, b.cl.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to check for opensearch index %s: %w", b.index, err)
+	}
+	defer exists.Body.Close()
+	if exists.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"settings": map[string]any{"index.knn": true},
+		"mappings": map[string]any{
+			"properties": map[string]any{
+				"embedding": map[string]any{
+					"type":      "knn_vector",
+					"dimension": dims,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := b.cl.Indices.Create(
+		b.index,
+		b.cl.Indices.Create.WithContext(ctx),
+		b.cl.Indices.Create.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create opensearch index %s: %w", b.index, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("failed to create opensearch index %s: %s", b.index, res.Status())
+	}
+	return nil
+}
+
+// Upsert implements IndexBackend.
+func (b *opensearchBackend) Upsert(ctx context.Context, doc DocumentRef, chunks []Chunk, vectors []Vector) error {
+	if len(vectors) > 0 {
+		if err := b.ensureIndex(ctx, len(vectors[0])); err != nil {
+			return err
+		}
+	}
+	for i, c := range chunks {
+		body, err := json.Marshal(opensearchDoc{
+			DocID:       doc.ID,
+			DocTitle:    doc.Title,
+			DocLink:     doc.Link,
+			ChunkNumber: c.Number,
+			Content:     c.Content,
+			Embedding:   vectors[i],
+		})
+		if err != nil {
+			return err
+		}
+		req := opensearchapi.IndexRequest{
+			Index:      b.index,
+			DocumentID: fmt.Sprintf("%s-%d", doc.ID, c.Number),
+			Body:       bytes.NewReader(body),
+		}
+		res, err := req.Do(ctx, b.cl)
+		if err != nil {
+			return fmt.Errorf("failed to index chunk %d of %s: %w", c.Number, doc.ID, err)
+		}
+		res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("opensearch index of chunk %d of %s failed: %s", c.Number, doc.ID, res.Status())
+		}
+	}
+	return nil
+}
+
+// Query implements IndexBackend.
+func (b *opensearchBackend) Query(ctx context.Context, vec Vector, topK int) ([]Hit, error) {
+	query, err := json.Marshal(map[string]any{
+		"size": topK,
+		"query": map[string]any{
+			"bool": map[string]any{
+				"must": map[string]any{
+					"knn": map[string]any{
+						"embedding": map[string]any{
+							"vector": vec,
+							"k":      topK,
+						},
+					},
+				},
+				"must_not": map[string]any{
+					"prefix": map[string]any{"_id": metaDocPrefix},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.cl.Search(
+		b.cl.Search.WithContext(ctx),
+		b.cl.Search.WithIndex(b.index),
+		b.cl.Search.WithBody(bytes.NewReader(query)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("opensearch query failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("opensearch query failed: %s", res.Status())
+	}
+
+	var parsed struct {
+		Hits struct {
+			Hits []struct {
+				Score  float64        `json:"_score"`
+				Source opensearchDoc  `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(parsed.Hits.Hits))
+	for i, h := range parsed.Hits.Hits {
+		hits[i] = Hit{
+			DocID:       h.Source.DocID,
+			DocTitle:    h.Source.DocTitle,
+			DocLink:     h.Source.DocLink,
+			ChunkNumber: h.Source.ChunkNumber,
+			Content:     h.Source.Content,
+			Score:       h.Score,
+		}
+	}
+	return hits, nil
+}
+
+// Load implements IndexBackend. OpenSearch is the source of truth, so
+// there's no local state to load.
+func (b *opensearchBackend) Load(path string) error { return nil }
+
+// Save implements IndexBackend. Documents are written through on every
+// Upsert, so there's nothing to flush here.
+func (b *opensearchBackend) Save(path string) error { return nil }
+
+// Header implements IndexBackend.
+func (b *opensearchBackend) Header() IndexHeader { return b.hdr }
+
+// SetHeader implements IndexBackend. It writes through to a dedicated
+// header document immediately since the opensearch backend has no
+// separate Save step.
+func (b *opensearchBackend) SetHeader(h IndexHeader) {
+	b.hdr = h
+	// Writing the header document into a missing index would create it
+	// by dynamic mapping, so create the knn-mapped index first.
+	if h.Dimensions > 0 {
+		if err := b.ensureIndex(context.Background(), h.Dimensions); err != nil {
+			return
+		}
+	}
+	body, err := json.Marshal(map[string]any{"header": h})
+	if err != nil {
+		return
+	}
+	req := opensearchapi.IndexRequest{
+		Index:      b.index,
+		DocumentID: headerDocID,
+		Body:       bytes.NewReader(body),
+	}
+	res, err := req.Do(context.Background(), b.cl)
+	if err == nil {
+		res.Body.Close()
+	}
+}
+
+// SyncState implements IndexBackend.
+func (b *opensearchBackend) SyncState(key string) (string, bool) {
+	res, err := b.cl.Get(b.index, syncStateDocID(key), b.cl.Get.WithContext(context.Background()))
+	if err != nil {
+		return "", false
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", false
+	}
+	var got struct {
+		Source struct {
+			Value string `json:"value"`
+		} `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		return "", false
+	}
+	return got.Source.Value, true
+}
+
+// SetSyncState implements IndexBackend. It writes through to a
+// dedicated document immediately since the opensearch backend has no
+// separate Save step.
+func (b *opensearchBackend) SetSyncState(key, value string) {
+	body, err := json.Marshal(map[string]any{"value": value})
+	if err != nil {
+		return
+	}
+	req := opensearchapi.IndexRequest{
+		Index:      b.index,
+		DocumentID: syncStateDocID(key),
+		Body:       bytes.NewReader(body),
+	}
+	res, err := req.Do(context.Background(), b.cl)
+	if err == nil {
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pgvector/pgvector-go"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresBackend stores chunk embeddings in a Postgres table using the
+// pgvector extension for nearest-neighbor search.
+type postgresBackend struct {
+	db  *sql.DB
+	hdr IndexHeader
+}
+
+// newPostgresBackend connects to the database named by the
+// AMA_POSTGRES_DSN env var and ensures the chunks table exists.
+func newPostgresBackend() (*postgresBackend, error) {
+	dsn := os.Getenv("AMA_POSTGRES_DSN")
+	if dsn == "" {
+		return nil, fmt.Errorf("AMA_POSTGRES_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	if _, err := db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS vector;
+		CREATE TABLE IF NOT EXISTS ama_chunks (
+			doc_id text NOT NULL,
+			doc_title text NOT NULL,
+			doc_link text NOT NULL,
+			chunk_number int NOT NULL,
+			content text NOT NULL,
+			embedding vector,
+			PRIMARY KEY (doc_id, chunk_number)
+		);
+		CREATE TABLE IF NOT EXISTS ama_meta (
+			key text PRIMARY KEY,
+			value jsonb NOT NULL
+		)
+	`); err != nil {
+		return nil, fmt.Errorf("failed to prepare postgres schema: %w", err)
+	}
+
+	b := &postgresBackend{db: db}
+	var raw []byte
+	err = db.QueryRow(`SELECT value FROM ama_meta WHERE key = 'header'`).Scan(&raw)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(raw, &b.hdr); err != nil {
+			return nil, fmt.Errorf("failed to parse stored index header: %w", err)
+		}
+	case sql.ErrNoRows:
+	default:
+		return nil, fmt.Errorf("failed to load index header: %w", err)
+	}
+	return b, nil
+}
+
+// Upsert implements IndexBackend.
+func (b *postgresBackend) Upsert(ctx context.Context, doc DocumentRef, chunks []Chunk, vectors []Vector) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ama_chunks WHERE doc_id = $1`, doc.ID); err != nil {
+		return err
+	}
+	for i, c := range chunks {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ama_chunks (doc_id, doc_title, doc_link, chunk_number, content, embedding)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, doc.ID, doc.Title, doc.Link, c.Number, c.Content, pgvector.NewVector(toFloat32(vectors[i]))); err != nil {
+			return fmt.Errorf("failed to upsert chunk %d of %s: %w", c.Number, doc.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Query implements IndexBackend.
+func (b *postgresBackend) Query(ctx context.Context, vec Vector, topK int) ([]Hit, error) {
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT doc_id, doc_title, doc_link, chunk_number, content, embedding <-> $1 AS score
+		FROM ama_chunks
+		ORDER BY score
+		LIMIT $2
+	`, pgvector.NewVector(toFloat32(vec)), topK)
+	if err != nil {
+		return nil, fmt.Errorf("postgres query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []Hit
+	for rows.Next() {
+		var h Hit
+		if err := rows.Scan(&h.DocID, &h.DocTitle, &h.DocLink, &h.ChunkNumber, &h.Content, &h.Score); err != nil {
+			return nil, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// Load implements IndexBackend. The postgres backend has no local
+// state to load; the table is the source of truth.
+func (b *postgresBackend) Load(path string) error { return nil }
+
+// Save implements IndexBackend. The postgres backend writes through on
+// every Upsert, so there's nothing to flush here.
+func (b *postgresBackend) Save(path string) error { return nil }
+
+// Header implements IndexBackend.
+func (b *postgresBackend) Header() IndexHeader { return b.hdr }
+
+// SetHeader implements IndexBackend. It writes through to ama_meta
+// immediately since the postgres backend has no separate Save step.
+func (b *postgresBackend) SetHeader(h IndexHeader) {
+	b.hdr = h
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+	_, _ = b.db.Exec(`
+		INSERT INTO ama_meta (key, value) VALUES ('header', $1)
+		ON CONFLICT (key) DO UPDATE SET value = $1
+	`, raw)
+}
+
+// SyncState implements IndexBackend.
+func (b *postgresBackend) SyncState(key string) (string, bool) {
+	var value string
+	err := b.db.QueryRow(`SELECT value #>> '{}' FROM ama_meta WHERE key = $1`, "sync:"+key).Scan(&value)
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// SetSyncState implements IndexBackend. It writes through to ama_meta
+// immediately since the postgres backend has no separate Save step.
+func (b *postgresBackend) SetSyncState(key, value string) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	_, _ = b.db.Exec(`
+		INSERT INTO ama_meta (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = $2
+	`, "sync:"+key, raw)
+}
+
+// toFloat32 converts a Vector to the float32 slice pgvector expects.
+func toFloat32(v Vector) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	clickupListFlag = flag.String("clickup-list", "", "ClickUp list ID to index (for -source=clickup)")
+	clickupTeamFlag = flag.String("clickup-team", "", "ClickUp team (workspace) ID to index all its lists (for -source=clickup)")
+)
+
+const clickupAPIBase = "https://api.clickup.com/api/v2"
+
+// clickupTask is the subset of the ClickUp task fields we care about.
+type clickupTask struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"text_content"`
+	URL         string `json:"url"`
+	DateUpdated string `json:"date_updated"`
+}
+
+// clickupComment is a single comment on a ClickUp task.
+type clickupComment struct {
+	CommentText string `json:"comment_text"`
+}
+
+// clickupGet issues an authenticated GET against the ClickUp v2 API
+// and decodes the JSON response into v.
+func clickupGet(ctx context.Context, path string, v any) error {
+	if clickupAPIToken == "" {
+		return fmt.Errorf("CLICKUP_API_KEY is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, clickupAPIBase+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", clickupAPIToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("clickup request to %s failed: %s: %s", path, resp.Status, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// clickupListTasks pages through every task in list, including closed
+// ones and subtasks.
+func clickupListTasks(ctx context.Context, listID string) ([]clickupTask, error) {
+	var tasks []clickupTask
+	for page := 0; ; page++ {
+		var resp struct {
+			Tasks    []clickupTask `json:"tasks"`
+			LastPage bool          `json:"last_page"`
+		}
+		path := fmt.Sprintf("/list/%s/task?include_closed=true&subtasks=true&page=%d", listID, page)
+		if err := clickupGet(ctx, path, &resp); err != nil {
+			return nil, fmt.Errorf("failed to list tasks for list %s: %w", listID, err)
+		}
+		tasks = append(tasks, resp.Tasks...)
+		if resp.LastPage || len(resp.Tasks) == 0 {
+			break
+		}
+	}
+	return tasks, nil
+}
+
+// clickupTaskComments fetches every comment on a task.
+func clickupTaskComments(ctx context.Context, taskID string) ([]clickupComment, error) {
+	var resp struct {
+		Comments []clickupComment `json:"comments"`
+	}
+	if err := clickupGet(ctx, fmt.Sprintf("/task/%s/comment", taskID), &resp); err != nil {
+		return nil, fmt.Errorf("failed to get comments for task %s: %w", taskID, err)
+	}
+	return resp.Comments, nil
+}
+
+// clickupListIDsForTeam resolves every list ID reachable from a team
+// (workspace), walking its spaces, folders and folderless lists.
+func clickupListIDsForTeam(ctx context.Context, teamID string) ([]string, error) {
+	var spaces struct {
+		Spaces []struct {
+			ID string `json:"id"`
+		} `json:"spaces"`
+	}
+	if err := clickupGet(ctx, fmt.Sprintf("/team/%s/space?archived=false", teamID), &spaces); err != nil {
+		return nil, fmt.Errorf("failed to list spaces for team %s: %w", teamID, err)
+	}
+
+	var listIDs []string
+	for _, space := range spaces.Spaces {
+		var folderless struct {
+			Lists []struct {
+				ID string `json:"id"`
+			} `json:"lists"`
+		}
+		if err := clickupGet(ctx, fmt.Sprintf("/space/%s/list?archived=false", space.ID), &folderless); err != nil {
+			return nil, fmt.Errorf("failed to list lists for space %s: %w", space.ID, err)
+		}
+		for _, l := range folderless.Lists {
+			listIDs = append(listIDs, l.ID)
+		}
+
+		var folders struct {
+			Folders []struct {
+				Lists []struct {
+					ID string `json:"id"`
+				} `json:"lists"`
+			} `json:"folders"`
+		}
+		if err := clickupGet(ctx, fmt.Sprintf("/space/%s/folder?archived=false", space.ID), &folders); err != nil {
+			return nil, fmt.Errorf("failed to list folders for space %s: %w", space.ID, err)
+		}
+		for _, f := range folders.Folders {
+			for _, l := range f.Lists {
+				listIDs = append(listIDs, l.ID)
+			}
+		}
+	}
+	return listIDs, nil
+}
+
+// runIndexClickUp ingests tasks (with their comments) from the ClickUp
+// list or team named by -clickup-list / -clickup-team, re-embedding
+// only tasks that changed since the last run.
+func runIndexClickUp(ctx context.Context, backend IndexBackend, embedder Embedder) error {
+	var listIDs []string
+	switch {
+	case *clickupListFlag != "":
+		listIDs = []string{*clickupListFlag}
+	case *clickupTeamFlag != "":
+		ids, err := clickupListIDsForTeam(ctx, *clickupTeamFlag)
+		if err != nil {
+			return err
+		}
+		listIDs = ids
+	default:
+		return fmt.Errorf("-clickup-list or -clickup-team is required with -source=clickup")
+	}
+
+	for _, listID := range listIDs {
+		if err := runIndexClickUpList(ctx, backend, embedder, listID); err != nil {
+			log.Printf("warning: failed to index clickup list %s: %v", listID, err)
+		}
+	}
+	return nil
+}
+
+// runIndexClickUpList indexes every task in a single ClickUp list,
+// skipping tasks that haven't changed since the last sync.
+func runIndexClickUpList(ctx context.Context, backend IndexBackend, embedder Embedder, listID string) error {
+	syncKey := "clickup:list:" + listID
+	since, _ := backend.SyncState(syncKey)
+	sinceMS, _ := strconv.ParseInt(since, 10, 64)
+
+	tasks, err := clickupListTasks(ctx, listID)
+	if err != nil {
+		return err
+	}
+
+	var maxSeenMS int64 = sinceMS
+	for _, task := range tasks {
+		updatedMS, _ := strconv.ParseInt(task.DateUpdated, 10, 64)
+		if updatedMS <= sinceMS {
+			continue
+		}
+
+		comments, err := clickupTaskComments(ctx, task.ID)
+		if err != nil {
+			log.Printf("warning: failed to get comments for task %s: %v", task.ID, err)
+			comments = nil
+		}
+		var commentText strings.Builder
+		for _, c := range comments {
+			commentText.WriteString("<p>")
+			commentText.WriteString(html.EscapeString(c.CommentText))
+			commentText.WriteString("</p>")
+		}
+
+		doc := Document{
+			Title: task.Name,
+			Link:  task.URL,
+			HTML:  "<p>" + html.EscapeString(task.Description) + "</p>" + commentText.String(),
+		}
+		if err := indexDocument(ctx, backend, embedder, "clickup:"+task.ID, &doc); err != nil {
+			log.Printf("warning: failed to index clickup task %s: %v", task.ID, err)
+			continue
+		}
+
+		if updatedMS > maxSeenMS {
+			maxSeenMS = updatedMS
+		}
+	}
+
+	if maxSeenMS > sinceMS {
+		backend.SetSyncState(syncKey, strconv.FormatInt(maxSeenMS, 10))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+// Embedder turns text into vector embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([]Vector, error)
+	// Provider and Model identify the embedder for the IndexHeader so
+	// an index can be checked for compatibility before it's queried.
+	Provider() string
+	Model() string
+}
+
+// Completer turns a prompt into a generated answer.
+type Completer interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// StreamingCompleter is implemented by Completers that can deliver their
+// answer incrementally, for use by the /stream endpoint. onToken is
+// called once per token in order; CompleteStream returns once the
+// answer is complete or onToken returns an error. Not every Completer
+// implements this.
+type StreamingCompleter interface {
+	CompleteStream(ctx context.Context, prompt string, onToken func(token string) error) error
+}
+
+var (
+	embedderFlag  = flag.String("embedder", envOr("AMA_EMBEDDER", "openai"), "Embedding provider to use: openai, compatible or bedrock")
+	completerFlag = flag.String("completer", envOr("AMA_COMPLETER", "openai"), "Completion provider to use: openai, compatible or bedrock")
+)
+
+// newEmbedder constructs the Embedder named by name.
+func newEmbedder(name string) (Embedder, error) {
+	switch name {
+	case "", "openai":
+		return newOpenAIEmbedder()
+	case "compatible":
+		return newCompatibleEmbedder()
+	case "bedrock":
+		return newBedrockEmbedder()
+	default:
+		return nil, fmt.Errorf("unknown embedder %q", name)
+	}
+}
+
+// newCompleter constructs the Completer named by name.
+func newCompleter(name string) (Completer, error) {
+	switch name {
+	case "", "openai":
+		return newOpenAICompleter()
+	case "compatible":
+		return newCompatibleCompleter()
+	case "bedrock":
+		return newBedrockCompleter()
+	default:
+		return nil, fmt.Errorf("unknown completer %q", name)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswDefaultM and hnswDefaultEfConstruction are the parameters used
+// when building a graph, matching the values recommended by the
+// original HNSW paper for a good recall/speed tradeoff.
+const (
+	hnswDefaultM              = 16
+	hnswDefaultEfConstruction = 200
+)
+
+// vectorNorm returns the L2 norm of v.
+func vectorNorm(v Vector) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+// cosineDistance returns 1 minus the cosine similarity of a and b,
+// given their precomputed norms. 0 means identical direction, 2 means
+// opposite.
+func cosineDistance(a Vector, aNorm float64, b Vector, bNorm float64) float64 {
+	if aNorm == 0 || bNorm == 0 {
+		return 1
+	}
+	var dot float64
+	for i, x := range a {
+		dot += x * b[i]
+	}
+	return 1 - dot/(aNorm*bNorm)
+}
+
+// Candidate is a single result from an HNSW search.
+type Candidate struct {
+	ID   int
+	Dist float64
+}
+
+// hnswNode is one inserted vector and its per-layer adjacency lists.
+type hnswNode struct {
+	Vector    Vector  `json:"vec"`
+	Norm      float64 `json:"norm"`
+	Neighbors [][]int `json:"neighbors"`
+}
+
+// HNSW is a hierarchical navigable small world graph over cosine
+// distance, used by fileBackend for approximate nearest neighbor
+// search instead of a full linear scan.
+type HNSW struct {
+	M              int        `json:"m"`
+	EfConstruction int        `json:"ef_construction"`
+	EntryPoint     int        `json:"entry_point"`
+	Nodes          []hnswNode `json:"nodes"`
+}
+
+// newHNSW returns an empty graph with the given build parameters.
+func newHNSW(m, efConstruction int) *HNSW {
+	return &HNSW{M: m, EfConstruction: efConstruction, EntryPoint: -1}
+}
+
+// randomLevel picks an insertion level from an exponentially decaying
+// distribution with level multiplier 1/ln(M), as in the HNSW paper, so
+// each level is reached with probability 1/M of the one below.
+func (h *HNSW) randomLevel() int {
+	ml := 1 / math.Log(float64(h.M))
+	return int(math.Floor(-math.Log(rand.Float64()) * ml))
+}
+
+// Insert adds vec as a new node, wiring it into the graph.
+func (h *HNSW) Insert(vec Vector) {
+	id := len(h.Nodes)
+	norm := vectorNorm(vec)
+	level := h.randomLevel()
+	h.Nodes = append(h.Nodes, hnswNode{
+		Vector:    vec,
+		Norm:      norm,
+		Neighbors: make([][]int, level+1),
+	})
+
+	if h.EntryPoint == -1 {
+		h.EntryPoint = id
+		return
+	}
+
+	entry := h.EntryPoint
+	entryLevel := len(h.Nodes[entry].Neighbors) - 1
+
+	cur := entry
+	for l := entryLevel; l > level; l-- {
+		cur = h.greedyClosest(cur, vec, norm, l)
+	}
+
+	top := level
+	if entryLevel < top {
+		top = entryLevel
+	}
+	for l := top; l >= 0; l-- {
+		candidates := h.searchLayer(vec, norm, []int{cur}, h.EfConstruction, l)
+		neighbors := h.selectNeighbors(vec, norm, candidates, h.M)
+		h.Nodes[id].Neighbors[l] = neighbors
+		for _, n := range neighbors {
+			h.connect(n, id, l)
+		}
+		if len(candidates) > 0 {
+			cur = candidates[0].ID
+		}
+	}
+
+	if level > entryLevel {
+		h.EntryPoint = id
+	}
+}
+
+// connect adds a back-edge from -> to at layer l, pruning from's
+// neighbor list back down to M using the same heuristic used at
+// insertion time if it grows too large.
+func (h *HNSW) connect(from, to, l int) {
+	h.Nodes[from].Neighbors[l] = append(h.Nodes[from].Neighbors[l], to)
+	if len(h.Nodes[from].Neighbors[l]) <= h.M {
+		return
+	}
+	fromVec, fromNorm := h.Nodes[from].Vector, h.Nodes[from].Norm
+	candidates := make([]Candidate, len(h.Nodes[from].Neighbors[l]))
+	for i, nid := range h.Nodes[from].Neighbors[l] {
+		candidates[i] = Candidate{ID: nid, Dist: cosineDistance(fromVec, fromNorm, h.Nodes[nid].Vector, h.Nodes[nid].Norm)}
+	}
+	h.Nodes[from].Neighbors[l] = h.selectNeighbors(fromVec, fromNorm, candidates, h.M)
+}
+
+// greedyClosest descends from cur within a single layer until no
+// neighbor is closer to query than cur itself.
+func (h *HNSW) greedyClosest(cur int, query Vector, queryNorm float64, layer int) int {
+	best := cur
+	bestDist := cosineDistance(query, queryNorm, h.Nodes[cur].Vector, h.Nodes[cur].Norm)
+	for {
+		improved := false
+		if layer < len(h.Nodes[best].Neighbors) {
+			for _, nid := range h.Nodes[best].Neighbors[layer] {
+				d := cosineDistance(query, queryNorm, h.Nodes[nid].Vector, h.Nodes[nid].Norm)
+				if d < bestDist {
+					bestDist, best, improved = d, nid, true
+				}
+			}
+		}
+		if !improved {
+			return best
+		}
+	}
+}
+
+// searchLayer is the standard HNSW SEARCH-LAYER routine: it explores
+// out from entryPoints maintaining a candidate min-heap to visit and a
+// result max-heap of size ef, returning the ef closest nodes found in
+// ascending order of distance.
+func (h *HNSW) searchLayer(query Vector, queryNorm float64, entryPoints []int, ef, layer int) []Candidate {
+	visited := make(map[int]bool, ef*2)
+	candidates := &minCandHeap{}
+	results := &maxCandHeap{}
+
+	for _, ep := range entryPoints {
+		d := cosineDistance(query, queryNorm, h.Nodes[ep].Vector, h.Nodes[ep].Norm)
+		heap.Push(candidates, Candidate{ep, d})
+		heap.Push(results, Candidate{ep, d})
+		visited[ep] = true
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(Candidate)
+		if results.Len() >= ef && c.Dist > (*results)[0].Dist {
+			break
+		}
+		if layer >= len(h.Nodes[c.ID].Neighbors) {
+			continue
+		}
+		for _, nid := range h.Nodes[c.ID].Neighbors[layer] {
+			if visited[nid] {
+				continue
+			}
+			visited[nid] = true
+			d := cosineDistance(query, queryNorm, h.Nodes[nid].Vector, h.Nodes[nid].Norm)
+			if results.Len() < ef {
+				heap.Push(candidates, Candidate{nid, d})
+				heap.Push(results, Candidate{nid, d})
+			} else if d < (*results)[0].Dist {
+				heap.Push(candidates, Candidate{nid, d})
+				heap.Push(results, Candidate{nid, d})
+				heap.Pop(results)
+			}
+		}
+	}
+
+	out := make([]Candidate, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(Candidate)
+	}
+	return out
+}
+
+// selectNeighbors implements the HNSW neighbor selection heuristic: it
+// keeps a candidate only if it's closer to query than to every
+// neighbor already kept, which favors spreading neighbors out over
+// just taking the m closest.
+func (h *HNSW) selectNeighbors(query Vector, queryNorm float64, candidates []Candidate, m int) []int {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Dist < candidates[j].Dist })
+
+	var kept []Candidate
+	for _, c := range candidates {
+		if len(kept) >= m {
+			break
+		}
+		good := true
+		for _, k := range kept {
+			if cosineDistance(h.Nodes[c.ID].Vector, h.Nodes[c.ID].Norm, h.Nodes[k.ID].Vector, h.Nodes[k.ID].Norm) < c.Dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			kept = append(kept, c)
+		}
+	}
+
+	ids := make([]int, len(kept))
+	for i, k := range kept {
+		ids[i] = k.ID
+	}
+	return ids
+}
+
+// Search returns the topK nodes closest to query, exploring with the
+// given efSearch.
+func (h *HNSW) Search(query Vector, efSearch, topK int) []Candidate {
+	if h.EntryPoint == -1 {
+		return nil
+	}
+	if efSearch < topK {
+		efSearch = topK
+	}
+
+	norm := vectorNorm(query)
+	cur := h.EntryPoint
+	topLayer := len(h.Nodes[h.EntryPoint].Neighbors) - 1
+	for l := topLayer; l > 0; l-- {
+		cur = h.greedyClosest(cur, query, norm, l)
+	}
+
+	candidates := h.searchLayer(query, norm, []int{cur}, efSearch, 0)
+	if len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+	return candidates
+}
+
+// minCandHeap pops the closest (smallest distance) candidate first.
+type minCandHeap []Candidate
+
+func (h minCandHeap) Len() int            { return len(h) }
+func (h minCandHeap) Less(i, j int) bool  { return h[i].Dist < h[j].Dist }
+func (h minCandHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minCandHeap) Push(x any)         { *h = append(*h, x.(Candidate)) }
+func (h *minCandHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// maxCandHeap pops the furthest (largest distance) candidate first, so
+// it's cheap to evict the worst member once it grows past ef.
+type maxCandHeap []Candidate
+
+func (h maxCandHeap) Len() int            { return len(h) }
+func (h maxCandHeap) Less(i, j int) bool  { return h[i].Dist > h[j].Dist }
+func (h maxCandHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxCandHeap) Push(x any)         { *h = append(*h, x.(Candidate)) }
+func (h *maxCandHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
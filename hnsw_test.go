@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteForceTopK returns the topK node IDs in h closest to query by
+// exhaustive scan, for comparison against HNSW.Search's approximate
+// result.
+func bruteForceTopK(h *HNSW, query Vector, topK int) []int {
+	norm := vectorNorm(query)
+	candidates := make([]Candidate, len(h.Nodes))
+	for i, n := range h.Nodes {
+		candidates[i] = Candidate{ID: i, Dist: cosineDistance(query, norm, n.Vector, n.Norm)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Dist < candidates[j].Dist })
+	if len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+	ids := make([]int, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// TestHNSWSearchRecall checks that HNSW.Search agrees with a brute-force
+// linear scan often enough to be useful: an indexing bug in insertion or
+// search would silently degrade recall rather than crash, so this is the
+// only thing that would catch one.
+func TestHNSWSearchRecall(t *testing.T) {
+	const (
+		numVectors = 500
+		dims       = 16
+		topK       = 10
+		efSearch   = 64
+		numQueries = 20
+	)
+
+	rng := rand.New(rand.NewSource(1))
+	randVec := func() Vector {
+		v := make(Vector, dims)
+		for i := range v {
+			v[i] = rng.Float64()*2 - 1
+		}
+		return v
+	}
+
+	h := newHNSW(hnswDefaultM, hnswDefaultEfConstruction)
+	for i := 0; i < numVectors; i++ {
+		h.Insert(randVec())
+	}
+
+	var hits, total int
+	for q := 0; q < numQueries; q++ {
+		query := randVec()
+		want := bruteForceTopK(h, query, topK)
+		got := h.Search(query, efSearch, topK)
+
+		wantSet := make(map[int]bool, len(want))
+		for _, id := range want {
+			wantSet[id] = true
+		}
+		for _, c := range got {
+			if wantSet[c.ID] {
+				hits++
+			}
+		}
+		total += len(want)
+	}
+
+	recall := float64(hits) / float64(total)
+	if recall < 0.8 {
+		t.Errorf("HNSW.Search recall@%d = %.2f over %d queries, want >= 0.80", topK, recall, numQueries)
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
 	"context"
 	_ "embed"
 	"encoding/json"
@@ -13,11 +12,9 @@ import (
 	"net/http"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
 
 	_ "github.com/oxplot/starenv/autoload"
-	gogpt "github.com/sashabaranov/go-gpt3"
 )
 
 var (
@@ -25,9 +22,13 @@ var (
 	clickupAPIToken = os.Getenv("CLICKUP_API_KEY")
 
 	indexFolderFlag = flag.Bool("index", false, "Index file paths passed on stdin")
+	sourceFlag      = flag.String("source", "file", "Ingestion source for -index mode: file or clickup")
 	cliQuery        = flag.String("query", "", "Run in command line mode")
+	formatFlag      = flag.String("format", "text", "Output format for -query mode: text or json")
 	listen          = flag.String("listen", "127.0.0.1:8080", "Listen address")
 	topic           = flag.String("topic", "TOPIC", "Topic name")
+	topKFlag        = flag.Int("topk", 20, "Number of closest chunks to retrieve from the index")
+	efFlag          = flag.Int("ef", 64, "efSearch parameter for HNSW nearest-neighbor search (file backend only)")
 
 	//go:embed index.html
 	indexHTML string
@@ -36,13 +37,11 @@ var (
 // Vector is a vector of floats.
 type Vector []float64
 
-// Distance returns the distance between two vectors.
+// Distance returns the cosine distance between two vectors: 0 for
+// identical direction, up to 2 for opposite. OpenAI embeddings are
+// L2-normalized, so this reduces to 1 minus their dot product.
 func (v Vector) Distance(v2 Vector) float64 {
-	var sum float64
-	for i, x := range v {
-		sum += (x - v2[i]) * (x - v2[i])
-	}
-	return sum
+	return cosineDistance(v, vectorNorm(v), v2, vectorNorm(v2))
 }
 
 // Document is a document to be indexed.
@@ -69,40 +68,78 @@ func (d *Document) Chunks() []string {
 	return chunks
 }
 
-// ChunkRef is a reference to a document chunk.
-type ChunkRef struct {
-	DocumentID  int `json:"doc"`
-	ChunkNumber int `json:"chunk"`
-}
+const indexPath = "index.json.gz"
 
-// Embedding is a vector embedding of a document chunk.
-type Embedding struct {
-	Vector  Vector `json:"vec"`
-	ChunkID int    `json:"chunk"`
-}
+// indexDocument embeds doc's chunks and upserts them into backend under
+// docID, validating (or, for the first document, recording) the
+// backend's IndexHeader against embedder.
+func indexDocument(ctx context.Context, backend IndexBackend, embedder Embedder, docID string, doc *Document) error {
+	chunkContents := doc.Chunks()
+	vectors, err := embedder.Embed(ctx, chunkContents)
+	if err != nil {
+		return fmt.Errorf("failed to get embeddings: %w", err)
+	}
+
+	hdr := IndexHeader{
+		EmbedderProvider: embedder.Provider(),
+		EmbedderModel:    embedder.Model(),
+		Dimensions:       len(vectors[0]),
+	}
+	if backend.Header().Empty() {
+		backend.SetHeader(hdr)
+	} else if !backend.Header().Compatible(hdr) {
+		return fmt.Errorf("index was built with embedder %+v, but %+v is configured", backend.Header(), hdr)
+	}
+
+	chunks := make([]Chunk, len(chunkContents))
+	for i, content := range chunkContents {
+		chunks[i] = Chunk{Number: i, Content: content}
+	}
+	ref := DocumentRef{ID: docID, Title: doc.Title, Link: doc.Link}
+	if err := backend.Upsert(ctx, ref, chunks, vectors); err != nil {
+		return fmt.Errorf("failed to store embeddings: %w", err)
+	}
 
-// Index is an index of documents.
-type Index struct {
-	Documents  []string    `json:"docs"`
-	Embeddings []Embedding `json:"embeddings"`
-	// ChunkHash -> ChunkRef
-	ChunkRefs []ChunkRef `json:"chunks"`
+	log.Printf("=> Indexed %s (%d chunks)", docID, len(chunks))
+	return nil
 }
 
-// runIndex indexes a folder of documents recursively.
+// runIndex indexes documents from the source named by -source.
 func runIndex() error {
 
 	ctx := context.Background()
 
-	if openAIAuthToken == "" {
-		return fmt.Errorf("OPENAI_API_KEY is not set")
+	embedder, err := newEmbedder(*embedderFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create embedder: %w", err)
 	}
-	aiCl := gogpt.NewClient(openAIAuthToken)
 
-	docs := make([]string, 0)
-	embeddings := make([]Embedding, 0)
-	chunkRefs := make([]ChunkRef, 0)
+	backend, err := newBackend(*backendFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create backend: %w", err)
+	}
+	// It's fine if there's no existing index to load yet.
+	_ = backend.Load(indexPath)
 
+	switch *sourceFlag {
+	case "", "file":
+		if err := runIndexFile(ctx, backend, embedder); err != nil {
+			return err
+		}
+	case "clickup":
+		if err := runIndexClickUp(ctx, backend, embedder); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown source %q", *sourceFlag)
+	}
+
+	return backend.Save(indexPath)
+}
+
+// runIndexFile indexes the documents whose paths are given one per
+// line on stdin.
+func runIndexFile(ctx context.Context, backend IndexBackend, embedder Embedder) error {
 	sc := bufio.NewScanner(os.Stdin)
 	for sc.Scan() {
 		path := sc.Text()
@@ -121,193 +158,316 @@ func runIndex() error {
 		}
 		f.Close()
 
-		// For each chunk, get the embedding.
-
-		chunks := doc.Chunks()
-		resp, err := aiCl.CreateEmbeddings(ctx, gogpt.EmbeddingRequest{
-			Input: chunks,
-			Model: gogpt.AdaEmbeddingV2,
-		})
-		if err != nil {
-			log.Printf("warning: failed to get embeddings for %s: %v", path, err)
-			continue
-		}
-
-		for i, emb := range resp.Data {
-			embeddings = append(embeddings, Embedding{
-				Vector:  emb.Embedding,
-				ChunkID: len(chunkRefs),
-			})
-			chunkRefs = append(chunkRefs, ChunkRef{
-				DocumentID:  len(docs),
-				ChunkNumber: i,
-			})
+		if err := indexDocument(ctx, backend, embedder, path, &doc); err != nil {
+			log.Printf("warning: failed to index %s: %v", path, err)
 		}
-
-		docs = append(docs, path)
-
-		log.Printf("=> Indexed %s (%d chunks)", path, len(chunks))
 	}
 	if sc.Err() != nil {
 		log.Printf("warning: failed to index all documents: %v", sc.Err())
 	}
+	return nil
+}
 
-	// Construct and store the index
-
-	idx := Index{
-		Documents:  docs,
-		Embeddings: embeddings,
-		ChunkRefs:  chunkRefs,
-	}
-	f, err := os.Create("index.json.gz")
+// retrieve embeds query, checks it's compatible with the index backend's
+// embedder, and returns the topK closest chunks along with the query's
+// own embedding (for citing which parts of them matched best).
+func retrieve(ctx context.Context, backend IndexBackend, embedder Embedder, query string) ([]Hit, Vector, error) {
+	vecs, err := embedder.Embed(ctx, []string{query})
 	if err != nil {
-		return err
-	}
-	gz := gzip.NewWriter(f)
-	defer gz.Close()
-	if err := json.NewEncoder(gz).Encode(idx); err != nil {
-		return err
+		return nil, nil, fmt.Errorf("failed to get embedding for query: %w", err)
 	}
-	return gz.Flush()
-}
+	qEmb := vecs[0]
 
-// loadIndex loads the index from disk.
-func loadIndex() (idx Index, err error) {
-	f, err := os.Open("index.json.gz")
-	if err != nil {
-		return
+	hdr := IndexHeader{
+		EmbedderProvider: embedder.Provider(),
+		EmbedderModel:    embedder.Model(),
+		Dimensions:       len(qEmb),
+	}
+	if !backend.Header().Compatible(hdr) {
+		return nil, nil, fmt.Errorf("index was built with embedder %+v, but %+v is configured", backend.Header(), hdr)
 	}
-	defer f.Close()
-	gz, err := gzip.NewReader(f)
+
+	hits, err := backend.Query(ctx, qEmb, *topKFlag)
 	if err != nil {
-		return
+		return nil, nil, fmt.Errorf("failed to query backend: %w", err)
 	}
-	err = json.NewDecoder(gz).Decode(&idx)
-	return
+	return hits, qEmb, nil
 }
 
-// runQuery runs a query against the index.
-func runQuery(idx Index, query string) (string, error) {
+// buildPrompt joins hit contents until there's 4Kb worth of text and
+// wraps them in the completion prompt for query.
+func buildPrompt(query string, hits []Hit) string {
+	var chunks []string
+	var contextSize int
+	for _, hit := range hits {
+		if contextSize+len(hit.Content) > 4*1024 {
+			break
+		}
+		chunks = append(chunks, hit.Content)
+		contextSize += len(hit.Content)
+	}
 
-	// Get the embedding for the query
+	prompt := `Answer the question as truthfully as possible using the provided text, and if the answer is not contained within the text below, say "I don't know"\n\n`
+	prompt += fmt.Sprintf("Context: %s\n\n", strings.Join(chunks, " "))
+	prompt += fmt.Sprintf("Q: %s\nA:", query)
+	return prompt
+}
 
-	ctx := context.Background()
-	aiCl := gogpt.NewClient(openAIAuthToken)
-	resp, err := aiCl.CreateEmbeddings(ctx, gogpt.EmbeddingRequest{
-		Input: []string{query},
-		Model: gogpt.AdaEmbeddingV2,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to get embedding for query: %w", err)
-	}
-	qEmb := resp.Data[0].Embedding
+// SourceHit is a single source an answer was drawn from, cited with the
+// sentence within it that best matches the query.
+type SourceHit struct {
+	DocTitle string `json:"doc_title"`
+	DocLink  string `json:"doc_link"`
+	Match    Match  `json:"match"`
+}
 
-	// Sort the documents by closest distance to the query
+// Match is a highlighted excerpt from a SourceHit, in the style of a
+// typical search result's highlight DTO: Value is the chunk's text,
+// MatchLevel is the cosine similarity of its best-matching sentence to
+// the query, and MatchedWords holds that sentence so callers can
+// highlight it within Value. Start and End are its byte offsets within
+// Value's UTF-8 encoding.
+type Match struct {
+	Value        string   `json:"value"`
+	MatchLevel   float64  `json:"matchLevel"`
+	MatchedWords []string `json:"matchedWords"`
+	Start        int      `json:"start"`
+	End          int      `json:"end"`
+}
 
-	sort.Slice(idx.Embeddings, func(i, j int) bool {
-		return idx.Embeddings[i].Vector.Distance(qEmb) < idx.Embeddings[j].Vector.Distance(qEmb)
-	})
+// sentenceSpan is a single sentence within a larger string, along with
+// its byte offsets there.
+type sentenceSpan struct {
+	Text       string
+	Start, End int
+}
 
-	// Join the chunk contents until we have 4Kb worth of text.
+var sentencePat = regexp.MustCompile(`[^.!?]+[.!?]+["')\]]*|[^.!?]+$`)
 
-	var chunks []string
-	var contextSize int
-	for _, emb := range idx.Embeddings {
-		chunkRef := idx.ChunkRefs[emb.ChunkID]
-		docPath := idx.Documents[chunkRef.DocumentID]
-		f, err := os.Open(docPath)
-		if err != nil {
-			return "", err
+// sentenceSpans splits content into sentences, keeping each one's
+// byte offsets within content.
+func sentenceSpans(content string) []sentenceSpan {
+	var spans []sentenceSpan
+	for _, loc := range sentencePat.FindAllStringIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		for start < end && strings.TrimSpace(content[start:start+1]) == "" {
+			start++
 		}
-		var doc Document
-		if err := json.NewDecoder(f).Decode(&doc); err != nil {
-			f.Close()
-			return "", err
+		for end > start && strings.TrimSpace(content[end-1:end]) == "" {
+			end--
 		}
-		f.Close()
-		chunkContent := doc.Chunks()[chunkRef.ChunkNumber]
-		if contextSize+len(chunkContent) > 4*1024 {
-			break
+		if start == end {
+			continue
 		}
-		chunks = append(chunks, chunkContent)
-		contextSize += len(chunkContent)
+		spans = append(spans, sentenceSpan{Text: content[start:end], Start: start, End: end})
 	}
+	return spans
+}
 
-	// Create the prompt
+// citeHits builds a SourceHit for each distinct document in hits, in the
+// order they first appear, highlighting the sentence that best matches
+// qVec within that document's first hit. Later hits from the same
+// document are not searched for a better sentence.
+func citeHits(ctx context.Context, embedder Embedder, qVec Vector, hits []Hit) ([]SourceHit, error) {
+	var sources []SourceHit
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		if seen[hit.DocID] {
+			continue
+		}
+		seen[hit.DocID] = true
+		src, err := citeHit(ctx, embedder, qVec, hit)
+		if err != nil {
+			return sources, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
 
-	prompt := `Answer the question as truthfully as possible using the provided text, and if the answer is not contained within the text below, say "I don't know"\n\n`
-	prompt += fmt.Sprintf("Context: %s\n\n", strings.Join(chunks, " "))
-	prompt += fmt.Sprintf("Q: %s\nA:", query)
+// citeHit re-embeds the sentences of hit's chunk and returns a SourceHit
+// highlighting whichever is closest to qVec. MatchLevel is always derived
+// from this re-embedding rather than hit.Score, since Score's units vary
+// by IndexBackend (cosine distance for the file backend, Euclidean for
+// postgres, the opensearch k-NN plugin's own _score for opensearch) and
+// so aren't comparable to the cosine similarity SourceHit.Match reports.
+func citeHit(ctx context.Context, embedder Embedder, qVec Vector, hit Hit) (SourceHit, error) {
+	spans := sentenceSpans(hit.Content)
+	texts := make([]string, len(spans))
+	for i, s := range spans {
+		texts[i] = s.Text
+	}
+	if len(texts) == 0 {
+		texts = []string{hit.Content}
+	}
 
-	// Generate the answer
+	vecs, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return SourceHit{}, fmt.Errorf("failed to embed sentences for citation: %w", err)
+	}
 
-	compResp, err := aiCl.CreateCompletion(ctx, gogpt.CompletionRequest{
-		Prompt:           prompt,
-		Model:            gogpt.GPT3TextDavinci003,
-		MaxTokens:        300,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		Temperature:      0,
-		PresencePenalty:  0,
-	})
+	best := 0
+	bestDist := qVec.Distance(vecs[0])
+	for i := 1; i < len(vecs); i++ {
+		if d := qVec.Distance(vecs[i]); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+
+	if len(spans) == 0 {
+		return SourceHit{
+			DocTitle: hit.DocTitle,
+			DocLink:  hit.DocLink,
+			Match:    Match{Value: hit.Content, MatchLevel: 1 - bestDist},
+		}, nil
+	}
+
+	return SourceHit{
+		DocTitle: hit.DocTitle,
+		DocLink:  hit.DocLink,
+		Match: Match{
+			Value:        hit.Content,
+			MatchLevel:   1 - bestDist,
+			MatchedWords: []string{spans[best].Text},
+			Start:        spans[best].Start,
+			End:          spans[best].End,
+		},
+	}, nil
+}
+
+// runQuery runs a query against the index, returning the answer and the
+// sources it was drawn from.
+func runQuery(backend IndexBackend, embedder Embedder, completer Completer, query string) (string, []SourceHit, error) {
+	ctx := context.Background()
+
+	hits, qVec, err := retrieve(ctx, backend, embedder, query)
 	if err != nil {
-		return "", fmt.Errorf("completion failed: %w", err)
+		return "", nil, err
 	}
+	prompt := buildPrompt(query, hits)
 
-	return compResp.Choices[0].Text, nil
+	answer, err := completer.Complete(ctx, prompt)
+	if err != nil {
+		return "", nil, fmt.Errorf("completion failed: %w", err)
+	}
+
+	sources, err := citeHits(ctx, embedder, qVec, hits)
+	if err != nil {
+		log.Printf("warning: failed to build citations: %v", err)
+	}
+
+	return answer, sources, nil
 }
 
 // runCLI runs the CLI version of the program.
 func runCLI(query string) error {
 
-	idx, err := loadIndex()
+	backend, err := newBackend(*backendFlag)
 	if err != nil {
+		return fmt.Errorf("failed to create backend: %w", err)
+	}
+	if err := backend.Load(indexPath); err != nil {
 		return fmt.Errorf("failed to load index: %w", err)
 	}
 
-	answer, err := runQuery(idx, query)
+	embedder, err := newEmbedder(*embedderFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create embedder: %w", err)
+	}
+	completer, err := newCompleter(*completerFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create completer: %w", err)
+	}
+
+	answer, sources, err := runQuery(backend, embedder, completer, query)
 	if err != nil {
 		return fmt.Errorf("failed to run query: %w", err)
 	}
 
-	fmt.Println(answer)
+	switch *formatFlag {
+	case "", "text":
+		fmt.Println(answer)
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Answer  string      `json:"answer"`
+			Sources []SourceHit `json:"sources"`
+		}{answer, sources})
+	default:
+		return fmt.Errorf("unknown format %q", *formatFlag)
+	}
 	return nil
 }
 
+// pageData is the data passed to the index.html template.
+type pageData struct {
+	Topic    string
+	Question string
+	Answer   string
+	Error    string
+	Sources  []SourceHit
+}
+
+// highlightMatch wraps the m.Start:m.End span of m.Value in <mark>
+// tags, escaping everything else, for use by the index.html template.
+// It slices by offset rather than searching for MatchedWords so that a
+// short matched sentence recurring elsewhere in Value doesn't get
+// highlighted everywhere it appears.
+func highlightMatch(m Match) template.HTML {
+	if m.Start < 0 || m.End < m.Start || m.End > len(m.Value) {
+		return template.HTML(template.HTMLEscapeString(m.Value))
+	}
+	before := template.HTMLEscapeString(m.Value[:m.Start])
+	matched := template.HTMLEscapeString(m.Value[m.Start:m.End])
+	after := template.HTMLEscapeString(m.Value[m.End:])
+	return template.HTML(before + "<mark>" + matched + "</mark>" + after)
+}
+
 // runServer runs the web server version of the program.
 func runServer() error {
 
-	idx, err := loadIndex()
+	backend, err := newBackend(*backendFlag)
 	if err != nil {
+		return fmt.Errorf("failed to create backend: %w", err)
+	}
+	if err := backend.Load(indexPath); err != nil {
 		return fmt.Errorf("failed to load index: %w", err)
 	}
 
-	_ = idx
+	embedder, err := newEmbedder(*embedderFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create embedder: %w", err)
+	}
+	completer, err := newCompleter(*completerFlag)
+	if err != nil {
+		return fmt.Errorf("failed to create completer: %w", err)
+	}
 
-	tpl := template.Must(template.New("index").Parse(indexHTML))
+	tpl := template.Must(template.New("index").Funcs(template.FuncMap{
+		"highlight": highlightMatch,
+	}).Parse(indexHTML))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
 
-		m := map[string]string{
-			"Topic":    *topic,
-			"Question": strings.TrimSpace(r.FormValue("q")),
+		m := pageData{
+			Topic:    *topic,
+			Question: strings.TrimSpace(r.FormValue("q")),
 		}
 
 		switch r.Method {
 		case http.MethodGet:
 		case http.MethodPost:
 
-			query := m["Question"]
-			if query != "" {
-				answer, err := runQuery(idx, query)
+			if m.Question != "" {
+				answer, sources, err := runQuery(backend, embedder, completer, m.Question)
 				if err != nil {
 					log.Printf("error: failed to run query: %s", err)
-					m["Error"] = "Sorry, can't answer this right now - try again later."
+					m.Error = "Sorry, can't answer this right now - try again later."
 				} else {
-					m["Answer"] = answer
+					m.Answer = answer
+					m.Sources = sources
 				}
 			}
 
@@ -320,12 +480,85 @@ func runServer() error {
 		tpl.Execute(w, m)
 	})
 
+	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := strings.TrimSpace(r.FormValue("q"))
+		if query == "" {
+			http.Error(w, "missing q parameter", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		ctx := r.Context()
+		hits, qVec, err := retrieve(ctx, backend, embedder, query)
+		if err != nil {
+			log.Printf("error: failed to run query: %s", err)
+			writeSSE(w, "error", "Sorry, can't answer this right now - try again later.")
+			flusher.Flush()
+			return
+		}
+
+		sources, err := citeHits(ctx, embedder, qVec, hits)
+		if err != nil {
+			log.Printf("warning: failed to build citations: %v", err)
+		}
+		for _, src := range sources {
+			b, err := json.Marshal(src)
+			if err != nil {
+				continue
+			}
+			writeSSE(w, "source", string(b))
+		}
+		flusher.Flush()
+
+		prompt := buildPrompt(query, hits)
+		onToken := func(token string) error {
+			writeSSE(w, "token", token)
+			flusher.Flush()
+			return nil
+		}
+
+		if sc, ok := completer.(StreamingCompleter); ok {
+			err = sc.CompleteStream(ctx, prompt, onToken)
+		} else {
+			var answer string
+			answer, err = completer.Complete(ctx, prompt)
+			if err == nil {
+				onToken(answer)
+			}
+		}
+		if err != nil {
+			log.Printf("error: completion failed: %s", err)
+			writeSSE(w, "error", "Sorry, can't answer this right now - try again later.")
+		}
+		writeSSE(w, "done", "")
+		flusher.Flush()
+	})
+
 	log.Printf("=> Listening on http://%s/", *listen)
 	http.ListenAndServe(*listen, nil)
 
 	return nil
 }
 
+// writeSSE writes a single Server-Sent Event of the given type to w.
+// Newlines in data are replaced with spaces, since SSE ends a data line
+// at "\n".
+func writeSSE(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, strings.ReplaceAll(data, "\n", " "))
+}
+
 func main() {
 	log.SetFlags(0)
 	flag.Parse()
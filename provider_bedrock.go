@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// bedrockEmbedder embeds text using a Bedrock embedding model (Titan or
+// Cohere) named by AMA_BEDROCK_EMBEDDING_MODEL.
+type bedrockEmbedder struct {
+	cl    *bedrockruntime.Client
+	model string
+}
+
+func newBedrockEmbedder() (*bedrockEmbedder, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &bedrockEmbedder{
+		cl:    bedrockruntime.NewFromConfig(cfg),
+		model: envOr("AMA_BEDROCK_EMBEDDING_MODEL", "amazon.titan-embed-text-v1"),
+	}, nil
+}
+
+func (e *bedrockEmbedder) Embed(ctx context.Context, texts []string) ([]Vector, error) {
+	if strings.HasPrefix(e.model, "cohere.") {
+		return e.embedCohere(ctx, texts)
+	}
+	return e.embedTitan(ctx, texts)
+}
+
+// embedTitan embeds texts one at a time using Amazon Titan's embedding
+// request/response shape, which only accepts a single input per call.
+func (e *bedrockEmbedder) embedTitan(ctx context.Context, texts []string) ([]Vector, error) {
+	vecs := make([]Vector, len(texts))
+	for i, text := range texts {
+		body, err := json.Marshal(map[string]string{"inputText": text})
+		if err != nil {
+			return nil, err
+		}
+		out, err := e.cl.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     &e.model,
+			ContentType: strPtr("application/json"),
+			Body:        body,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bedrock embedding failed: %w", err)
+		}
+		var parsed struct {
+			Embedding Vector `json:"embedding"`
+		}
+		if err := json.Unmarshal(out.Body, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse bedrock embedding response: %w", err)
+		}
+		vecs[i] = parsed.Embedding
+	}
+	return vecs, nil
+}
+
+// embedCohere embeds texts using Cohere's Bedrock embedding request/
+// response shape, which takes a batch of texts in one call.
+func (e *bedrockEmbedder) embedCohere(ctx context.Context, texts []string) ([]Vector, error) {
+	body, err := json.Marshal(map[string]any{
+		"texts":      texts,
+		"input_type": "search_document",
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := e.cl.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     &e.model,
+		ContentType: strPtr("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bedrock embedding failed: %w", err)
+	}
+	var parsed struct {
+		Embeddings []Vector `json:"embeddings"`
+	}
+	if err := json.Unmarshal(out.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse bedrock embedding response: %w", err)
+	}
+	if len(parsed.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("bedrock embedding returned %d vectors for %d inputs", len(parsed.Embeddings), len(texts))
+	}
+	return parsed.Embeddings, nil
+}
+
+func (e *bedrockEmbedder) Provider() string { return "bedrock" }
+func (e *bedrockEmbedder) Model() string    { return e.model }
+
+// bedrockCompleter generates answers using a Bedrock Claude model named
+// by AMA_BEDROCK_COMPLETION_MODEL.
+type bedrockCompleter struct {
+	cl    *bedrockruntime.Client
+	model string
+}
+
+func newBedrockCompleter() (*bedrockCompleter, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &bedrockCompleter{
+		cl:    bedrockruntime.NewFromConfig(cfg),
+		model: envOr("AMA_BEDROCK_COMPLETION_MODEL", "anthropic.claude-v2"),
+	}, nil
+}
+
+func (c *bedrockCompleter) Complete(ctx context.Context, prompt string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"prompt":               fmt.Sprintf("\n\nHuman: %s\n\nAssistant:", prompt),
+		"max_tokens_to_sample": 300,
+		"temperature":          0,
+	})
+	if err != nil {
+		return "", err
+	}
+	out, err := c.cl.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     &c.model,
+		ContentType: strPtr("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return "", fmt.Errorf("bedrock completion failed: %w", err)
+	}
+	var parsed struct {
+		Completion string `json:"completion"`
+	}
+	if err := json.Unmarshal(out.Body, &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse bedrock completion response: %w", err)
+	}
+	return parsed.Completion, nil
+}
+
+// strPtr returns a pointer to s, for AWS SDK fields that take *string.
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	gogpt "github.com/sashabaranov/go-openai"
+)
+
+// newCompatibleClient builds a go-openai client pointed at an
+// OpenAI-compatible endpoint (LocalAI, or any other drop-in server)
+// configured via AMA_COMPATIBLE_BASE_URL. The API key is optional since
+// most self-hosted servers don't check it.
+func newCompatibleClient() (*gogpt.Client, error) {
+	baseURL := os.Getenv("AMA_COMPATIBLE_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("AMA_COMPATIBLE_BASE_URL is not set")
+	}
+	cfg := gogpt.DefaultConfig(envOr("AMA_COMPATIBLE_API_KEY", "unused"))
+	cfg.BaseURL = baseURL
+	return gogpt.NewClientWithConfig(cfg), nil
+}
+
+// compatibleEmbedder embeds text using an OpenAI-compatible endpoint.
+type compatibleEmbedder struct {
+	cl    *gogpt.Client
+	model string
+}
+
+func newCompatibleEmbedder() (*compatibleEmbedder, error) {
+	cl, err := newCompatibleClient()
+	if err != nil {
+		return nil, err
+	}
+	return &compatibleEmbedder{
+		cl:    cl,
+		model: envOr("AMA_COMPATIBLE_EMBEDDING_MODEL", "text-embedding-ada-002"),
+	}, nil
+}
+
+func (e *compatibleEmbedder) Embed(ctx context.Context, texts []string) ([]Vector, error) {
+	resp, err := e.cl.CreateEmbeddings(ctx, gogpt.EmbeddingRequest{
+		Input: texts,
+		Model: gogpt.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compatible embedding failed: %w", err)
+	}
+	vecs := make([]Vector, len(resp.Data))
+	for i, d := range resp.Data {
+		vecs[i] = d.Embedding
+	}
+	return vecs, nil
+}
+
+func (e *compatibleEmbedder) Provider() string { return "compatible" }
+func (e *compatibleEmbedder) Model() string    { return e.model }
+
+// compatibleCompleter generates answers using an OpenAI-compatible
+// endpoint.
+type compatibleCompleter struct {
+	cl    *gogpt.Client
+	model string
+}
+
+func newCompatibleCompleter() (*compatibleCompleter, error) {
+	cl, err := newCompatibleClient()
+	if err != nil {
+		return nil, err
+	}
+	return &compatibleCompleter{
+		cl:    cl,
+		model: envOr("AMA_COMPATIBLE_COMPLETION_MODEL", "gpt-3.5-turbo-instruct"),
+	}, nil
+}
+
+func (c *compatibleCompleter) Complete(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.cl.CreateCompletion(ctx, gogpt.CompletionRequest{
+		Prompt:    prompt,
+		Model:     c.model,
+		MaxTokens: 300,
+		TopP:      1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("compatible completion failed: %w", err)
+	}
+	return resp.Choices[0].Text, nil
+}
+
+// CompleteStream implements StreamingCompleter.
+func (c *compatibleCompleter) CompleteStream(ctx context.Context, prompt string, onToken func(token string) error) error {
+	stream, err := c.cl.CreateCompletionStream(ctx, gogpt.CompletionRequest{
+		Prompt:    prompt,
+		Model:     c.model,
+		MaxTokens: 300,
+		TopP:      1,
+	})
+	if err != nil {
+		return fmt.Errorf("compatible streaming completion failed: %w", err)
+	}
+	defer stream.Close()
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("compatible streaming completion failed: %w", err)
+		}
+		if err := onToken(resp.Choices[0].Text); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	gogpt "github.com/sashabaranov/go-gpt3"
+)
+
+const openAIEmbeddingDimensions = 1536
+
+// openAIEmbedder embeds text using OpenAI's Ada v2 embedding model.
+type openAIEmbedder struct {
+	cl *gogpt.Client
+}
+
+func newOpenAIEmbedder() (*openAIEmbedder, error) {
+	if openAIAuthToken == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	return &openAIEmbedder{cl: gogpt.NewClient(openAIAuthToken)}, nil
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([]Vector, error) {
+	resp, err := e.cl.CreateEmbeddings(ctx, gogpt.EmbeddingRequest{
+		Input: texts,
+		Model: gogpt.AdaEmbeddingV2,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openai embedding failed: %w", err)
+	}
+	vecs := make([]Vector, len(resp.Data))
+	for i, d := range resp.Data {
+		vecs[i] = d.Embedding
+	}
+	return vecs, nil
+}
+
+func (e *openAIEmbedder) Provider() string { return "openai" }
+func (e *openAIEmbedder) Model() string    { return gogpt.AdaEmbeddingV2.String() }
+
+// openAICompleter generates answers using OpenAI's text-davinci-003.
+type openAICompleter struct {
+	cl *gogpt.Client
+}
+
+func newOpenAICompleter() (*openAICompleter, error) {
+	if openAIAuthToken == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	return &openAICompleter{cl: gogpt.NewClient(openAIAuthToken)}, nil
+}
+
+func (c *openAICompleter) Complete(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.cl.CreateCompletion(ctx, gogpt.CompletionRequest{
+		Prompt:           prompt,
+		Model:            gogpt.GPT3TextDavinci003,
+		MaxTokens:        300,
+		TopP:             1,
+		FrequencyPenalty: 0,
+		Temperature:      0,
+		PresencePenalty:  0,
+	})
+	if err != nil {
+		return "", fmt.Errorf("openai completion failed: %w", err)
+	}
+	return resp.Choices[0].Text, nil
+}
+
+// CompleteStream implements StreamingCompleter.
+func (c *openAICompleter) CompleteStream(ctx context.Context, prompt string, onToken func(token string) error) error {
+	stream, err := c.cl.CreateCompletionStream(ctx, gogpt.CompletionRequest{
+		Prompt:           prompt,
+		Model:            gogpt.GPT3TextDavinci003,
+		MaxTokens:        300,
+		TopP:             1,
+		FrequencyPenalty: 0,
+		Temperature:      0,
+		PresencePenalty:  0,
+	})
+	if err != nil {
+		return fmt.Errorf("openai streaming completion failed: %w", err)
+	}
+	defer stream.Close()
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("openai streaming completion failed: %w", err)
+		}
+		if err := onToken(resp.Choices[0].Text); err != nil {
+			return err
+		}
+	}
+}